@@ -1,52 +1,37 @@
 package handler
 
 import (
+	"archive/tar"
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	git "github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/google/go-github/v32/github"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/oauth2"
 	webhook "gopkg.in/go-playground/webhooks.v5/github"
-)
 
-// Filenames lists all javascript files subject to modification
-// on the upstream repository. Not ideal, but this is a workaround
-// for Vercel's hard resource limits on its free tier (15 seconds of
-// maximum runtime and 5MB of downloads).
-var filenames = []string{
-	"asyoutypeformatter_test.js",
-	"demo-compiled.js",
-	"demo.js",
-	"metadata.js",
-	"metadatafortesting.js",
-	"metadatalite.js",
-	"phonemetadata.pb.js",
-	"phonenumber.pb.js",
-	"phonenumberutil.js",
-	"phonenumberutil_test.js",
-	"regioncodefortesting.js",
-	"shortnumberinfo.js",
-	"shortnumberinfo_test.js",
-	"shortnumbermetadata.js",
-}
+	"github.com/ruimarinho/libphonenumber-hook/gitsource"
+	"github.com/ruimarinho/libphonenumber-hook/signature"
+	"github.com/ruimarinho/libphonenumber-hook/store"
+)
 
 const (
-	remoteRepositoryUsername = "ruimarinho"
-	remoteRepositoryName     = "google-libphonenumber"
-	remoteBranchFormat       = "support/update-libphonenumber-%s"
+	remoteBranchFormat = "support/update-libphonenumber-%s"
+
+	// downloadTimeout bounds the whole tarball fetch + extract operation,
+	// honoring Vercel's 15 second maximum runtime on its free tier.
+	downloadTimeout      = 15 * time.Second
+	downloadMaxAttempts  = 3
+	downloadInitialDelay = 500 * time.Millisecond
 )
 
 // CommitOptions holds information about commit options.
@@ -54,6 +39,24 @@ type CommitOptions struct {
 	Push bool
 }
 
+var (
+	dataStore     store.Store
+	dataStoreErr  error
+	dataStoreOnce sync.Once
+)
+
+// getStore returns the process-wide Store, constructing it from the
+// environment on first use. Serverless invocations in the same warm
+// instance share it so delivery/version dedup actually dedups instead of
+// starting from an empty map on every call.
+func getStore() (store.Store, error) {
+	dataStoreOnce.Do(func() {
+		dataStore, dataStoreErr = store.NewFromEnv()
+	})
+
+	return dataStore, dataStoreErr
+}
+
 // Handler is called automatically by Vercel Serverless platform.
 func Handler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
@@ -62,6 +65,13 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if err := signature.Verify(r, os.Getenv("GITHUB_WEBHOOK_SECRET")); err != nil {
+		log.WithError(err).Warn("Rejecting webhook with invalid signature")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Invalid signature"))
+		return
+	}
+
 	hook, err := webhook.New()
 	if err != nil {
 		log.Panic(err)
@@ -72,15 +82,37 @@ func Handler(w http.ResponseWriter, r *http.Request) {
 		log.Panic(err)
 	}
 
-	HandleEvent(payload)
+	HandleEvent(payload, r.Header.Get("X-GitHub-Delivery"))
 
 	w.Write([]byte("OK"))
 }
 
-// HandleEvent handles multiple GitHub events.
-func HandleEvent(payload interface{}) {
+// HandleEvent handles multiple GitHub events. deliveryID is the value of
+// the X-GitHub-Delivery header, if any, and is used to dedupe retried
+// webhook deliveries.
+func HandleEvent(payload interface{}, deliveryID string) {
 	log.WithField("payload", payload).Info("Handling incoming webhook")
 
+	dataStore, err := getStore()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	deliveryKey := ""
+	if deliveryID != "" {
+		deliveryKey = fmt.Sprintf("delivery:%s", deliveryID)
+
+		seen, err := dataStore.Seen(deliveryKey)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if seen {
+			log.Infof("Delivery %s already processed, skipping", deliveryID)
+			return
+		}
+	}
+
 	push := payload.(webhook.PushPayload)
 	if !strings.Contains(push.Ref, "refs/tags/") {
 		log.Warn("Push reference is not a tag, skipping")
@@ -91,66 +123,130 @@ func HandleEvent(payload interface{}) {
 
 	log.Infof("Received push payload for version v%s", version)
 
-	directory, repository, err := Clone(fmt.Sprintf("%s/%s", remoteRepositoryUsername, remoteRepositoryName))
+	source, err := gitsource.NewFromEnv()
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = Commit(version, directory, repository, &CommitOptions{Push: true})
+	versionKey := fmt.Sprintf("version:%s", version)
+
+	seen, err := dataStore.Seen(versionKey)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	OpenPullRequest(version)
-}
+	if seen {
+		log.Infof("Version %s already processed, skipping", version)
+		return
+	}
+
+	ctx := context.Background()
+	branch := fmt.Sprintf(remoteBranchFormat, strings.Replace(version, ".", "-", -1))
 
-// Clone a repository into a temporary folder.
-func Clone(repositoryName string) (string, *git.Repository, error) {
-	directory, err := ioutil.TempDir("", strings.ReplaceAll(repositoryName, "/", "-"))
+	exists, err := source.Exists(branch)
 	if err != nil {
-		return directory, nil, err
+		log.Panic(err)
 	}
 
-	log.Infof("Cloning %s to %s", repositoryName, directory)
+	if exists {
+		log.Infof("Branch or pull request for %s already exists, skipping", branch)
+		return
+	}
 
-	gitRepository, err := git.PlainClone(directory, false, &git.CloneOptions{
-		URL:           fmt.Sprintf("https://github.com/%s.git", repositoryName),
-		ReferenceName: plumbing.ReferenceName(fmt.Sprintf("refs/heads/master")),
-		Progress:      os.Stdout,
-	})
+	checks, _ := source.(gitsource.ChecksReporter)
+
+	var checkRun gitsource.CheckRun
+	if checks != nil {
+		checkRun, err = checks.CreateCheckRun(push.After)
+		if err != nil {
+			log.Panic(err)
+		}
+	}
+
+	fail := func(err error) {
+		if checks != nil {
+			checks.CompleteCheckRun(checkRun, "failure", err.Error())
+		}
+
+		log.Panic(err)
+	}
+
+	directory, repository, err := source.Clone()
 	if err != nil {
-		return directory, nil, err
+		fail(err)
+	}
+
+	stats, err := Commit(ctx, source, version, directory, repository, &CommitOptions{Push: true})
+	if err != nil {
+		fail(err)
+	}
+
+	url, err := source.OpenMergeRequest(branch, fmt.Sprintf("Update libphonenumber@%s", version), renderPullRequestBody(version, stats))
+	if err != nil {
+		fail(err)
+	}
+
+	log.Infof("Pull request opened (%s)", url)
+
+	// Only mark the version (and the delivery that triggered it) as seen
+	// once the pull request actually exists; none of the stores expire
+	// entries, so marking any earlier would permanently skip a legitimate
+	// retry after a transient Clone/Commit/OpenMergeRequest failure.
+	if err := dataStore.Mark(versionKey); err != nil {
+		log.Panic(err)
 	}
 
-	log.Infof("Cloned %s into %s", repositoryName, directory)
+	if deliveryKey != "" {
+		if err := dataStore.Mark(deliveryKey); err != nil {
+			log.Panic(err)
+		}
+	}
 
-	return directory, gitRepository, nil
+	if checks != nil {
+		checks.CompleteCheckRun(checkRun, "success", fmt.Sprintf("Updated libphonenumber to v%s.", version))
+	}
 }
 
-// Commit creates a branch and commits the modified index tree on that branch.
-func Commit(version string, directory string, repository *git.Repository, options *CommitOptions) error {
+// Commit creates a branch and commits the modified index tree on that
+// branch, after validating the extracted files, returning the per-file
+// line stats between the branch's base commit and the new commit.
+func Commit(ctx context.Context, source gitsource.Provider, version string, directory string, repository *git.Repository, options *CommitOptions) (object.FileStats, error) {
 	worktree, err := repository.Worktree()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	head, err := repository.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	baseCommit, err := repository.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
+	}
+
+	branch := fmt.Sprintf(remoteBranchFormat, strings.Replace(version, ".", "-", -1))
+
 	err = worktree.Checkout(&git.CheckoutOptions{
 		Create: true,
-		Branch: plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", fmt.Sprintf(remoteBranchFormat, strings.Replace(version, ".", "-", -1)))),
+		Branch: plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", branch)),
 		Force:  true,
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	for _, filename := range filenames {
-		_, err := Download(fmt.Sprintf("google/libphonenumber/v%s/javascript/i18n/phonenumbers/%s", version, filename), fmt.Sprintf("%s/src", directory))
-		if err != nil {
-			log.Fatal(err)
-		}
+	err = Download(ctx, version, directory)
+	if err != nil {
+		return nil, err
 	}
 
-	commit, err := worktree.Commit(fmt.Sprintf("Update libphonenumber@%s", version), &git.CommitOptions{
+	if err := Validate(ctx, version, directory); err != nil {
+		return nil, err
+	}
+
+	commitHash, err := worktree.Commit(fmt.Sprintf("Update libphonenumber@%s", version), &git.CommitOptions{
 		All: true,
 		Author: &object.Signature{
 			Name:  "Rui Marinho",
@@ -159,92 +255,147 @@ func Commit(version string, directory string, repository *git.Repository, option
 		},
 	})
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	log.Infof("Git commit %s", commit.String())
+	log.Infof("Git commit %s", commitHash.String())
 
-	if !options.Push {
-		log.Warn("Skipping commit push")
-		return nil
+	currentCommit, err := repository.CommitObject(commitHash)
+	if err != nil {
+		return nil, err
 	}
 
-	remote, err := repository.Remote("origin")
+	patch, err := baseCommit.Patch(currentCommit)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	log.Infof("Pushing to remote origin %s", remote.Config().URLs[0])
+	stats := patch.Stats()
 
-	tag := strings.Replace(version, ".", "-", -1)
-	pushOptions := git.PushOptions{
-		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("refs/heads/%s:refs/heads/%s", fmt.Sprintf(remoteBranchFormat, tag), fmt.Sprintf(remoteBranchFormat, tag)))},
-		Auth: &githttp.BasicAuth{
-			Username: remoteRepositoryUsername,
-			Password: os.Getenv("GITHUB_TOKEN"),
-		},
-		Progress: os.Stdout,
+	if !options.Push {
+		log.Warn("Skipping commit push")
+		return stats, nil
 	}
 
-	err = remote.Push(&pushOptions)
-	if err != nil {
-		return err
+	if err := source.Push(repository, branch); err != nil {
+		return stats, err
 	}
 
-	log.Infof("Pushed to %s successfully", fmt.Sprintf(remoteBranchFormat, tag))
-
-	return nil
+	return stats, nil
 }
 
-// Download a file path into a target directory.
-func Download(path string, directory string) (*os.File, error) {
-	filename := filepath.Base(path)
-	file, err := os.Create(fmt.Sprintf("%s/%s", directory, filename))
-	url := fmt.Sprintf("https://raw.githubusercontent.com/%s", path)
+// Download fetches the libphonenumber release tarball for version and
+// extracts its javascript files into directory/src, retrying transient
+// failures with exponential backoff. The whole operation is bound by a
+// downloadTimeout context deadline so a slow or flaky upstream can't
+// overrun Vercel's execution limit.
+func Download(ctx context.Context, version string, directory string) error {
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
 
-	if err != nil {
-		return nil, err
-	}
+	url := fmt.Sprintf("https://github.com/google/libphonenumber/archive/v%s.tar.gz", version)
 
-	defer file.Close()
+	var body io.ReadCloser
+	err := withRetry(ctx, retryOptions{MaxAttempts: downloadMaxAttempts, InitialDelay: downloadInitialDelay}, func() error {
+		log.Infof("Downloading %s", url)
 
-	log.Infof("Downloading %s from %s into directory %s", filename, url, directory)
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+		if err != nil {
+			return &permanentError{err}
+		}
 
-	response, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			return err
+		}
 
-	defer response.Body.Close()
+		if response.StatusCode >= http.StatusInternalServerError {
+			response.Body.Close()
+			return fmt.Errorf("received status code %d downloading %s", response.StatusCode, url)
+		}
 
-	_, err = io.Copy(file, response.Body)
+		if response.StatusCode != http.StatusOK {
+			response.Body.Close()
+			return &permanentError{fmt.Errorf("received status code %d downloading %s", response.StatusCode, url)}
+		}
+
+		body = response.Body
+
+		return nil
+	})
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	log.Infof("File %s downloaded successfully", path)
+	defer body.Close()
 
-	return file, err
+	return Extract(body, directory)
 }
 
-// OpenPullRequest opens a pull request for a specific branch.
-func OpenPullRequest(version string) error {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: os.Getenv("GITHUB_TOKEN")})
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-	pull, _, err := client.PullRequests.Create(ctx, remoteRepositoryUsername, remoteRepositoryName, &github.NewPullRequest{
-		Title: github.String(fmt.Sprintf("Update libphonenumber@%s", version)),
-		Head:  github.String(fmt.Sprintf(remoteBranchFormat, strings.Replace(version, ".", "-", -1))),
-		Base:  github.String("master"),
-		Body:  github.String(fmt.Sprintf("Update libphonenumber@%s.", version)),
-	})
-
+// Extract reads a gzip-compressed tarball of a libphonenumber release and
+// writes the javascript files under javascript/i18n/phonenumbers/ into
+// directory/src.
+func Extract(reader io.Reader, directory string) error {
+	gzipReader, err := gzip.NewReader(reader)
 	if err != nil {
 		return err
 	}
 
-	log.Info(fmt.Sprintf("Pull request #%d opened (%v)", *pull.Number, *pull.HTMLURL))
+	defer gzipReader.Close()
+
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if header.Typeflag != tar.TypeReg || !strings.Contains(header.Name, "javascript/i18n/phonenumbers/") {
+			continue
+		}
+
+		path := filepath.Join(directory, "src", filepath.Base(header.Name))
+
+		log.WithField("file", path).Info("Extracting file")
+
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_RDWR, header.FileInfo().Mode())
+		if err != nil {
+			return err
+		}
+
+		_, err = io.Copy(file, tarReader)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
+
+// renderPullRequestBody builds a Markdown pull request body summarizing
+// the update, linking to the upstream release notes and listing the
+// added/removed line counts of each changed file.
+func renderPullRequestBody(version string, stats object.FileStats) string {
+	var body strings.Builder
+
+	fmt.Fprintf(&body, "Update libphonenumber@%s.\n\n", version)
+	fmt.Fprintf(&body, "See the [upstream release notes](https://github.com/google/libphonenumber/releases/tag/v%s) for details.\n\n", version)
+
+	if len(stats) == 0 {
+		return body.String()
+	}
+
+	body.WriteString("| File | Added | Removed |\n")
+	body.WriteString("| --- | ---: | ---: |\n")
+
+	for _, stat := range stats {
+		fmt.Fprintf(&body, "| %s | +%d | -%d |\n", filepath.Base(stat.Name), stat.Addition, stat.Deletion)
+	}
+
+	return body.String()
+}
@@ -0,0 +1,96 @@
+package handler
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	webhook "gopkg.in/go-playground/webhooks.v5/github"
+)
+
+// testTagPushPayload targets a tag so HandleEvent reaches the
+// version-dedup check, unlike testPushPayload (a branch push).
+const testTagPushPayload = `{
+	"ref": "refs/tags/v99.9.9",
+	"repository": {
+		"id": 1,
+		"name": "google-libphonenumber",
+		"full_name": "ruimarinho/google-libphonenumber"
+	},
+	"pusher": {
+		"name": "ruimarinho"
+	}
+}`
+
+func parseTestPayload(t *testing.T, body string) interface{} {
+	t.Helper()
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-GitHub-Event", "push")
+
+	hook, err := webhook.New()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload, err := hook.Parse(request, webhook.PushEvent)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	return payload
+}
+
+func TestHandleEventDoesNotMarkDeliveryForNonTagPush(t *testing.T) {
+	payload := parseTestPayload(t, testPushPayload)
+	deliveryID := "11111111-1111-1111-1111-111111111111"
+
+	// Calling twice must not panic, and since the payload targets a
+	// branch rather than a tag, no work is ever done for it.
+	HandleEvent(payload, deliveryID)
+	HandleEvent(payload, deliveryID)
+
+	dataStore, err := getStore()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	seen, err := dataStore.Seen(fmt.Sprintf("delivery:%s", deliveryID))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if seen {
+		t.Fatal("delivery must not be marked seen when HandleEvent never did any work for it")
+	}
+}
+
+func TestHandleEventDoesNotMarkDeliveryWhenVersionAlreadyProcessed(t *testing.T) {
+	dataStore, err := getStore()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Pre-mark the version as already processed so HandleEvent short-
+	// circuits before ever touching the network, the same way a transient
+	// Clone/Commit/OpenMergeRequest failure would leave it unmarked.
+	if err := dataStore.Mark("version:99.9.9"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	payload := parseTestPayload(t, testTagPushPayload)
+	deliveryID := "22222222-2222-2222-2222-222222222222"
+
+	HandleEvent(payload, deliveryID)
+
+	seen, err := dataStore.Seen(fmt.Sprintf("delivery:%s", deliveryID))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if seen {
+		t.Fatal("delivery must not be marked seen when the underlying work never actually ran")
+	}
+}
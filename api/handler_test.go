@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// testPushPayload deliberately targets a branch instead of a tag so that a
+// request with a valid signature is rejected by HandleEvent before it
+// attempts any network calls.
+const testPushPayload = `{
+	"ref": "refs/heads/master",
+	"repository": {
+		"id": 1,
+		"name": "google-libphonenumber",
+		"full_name": "ruimarinho/google-libphonenumber"
+	},
+	"pusher": {
+		"name": "ruimarinho"
+	}
+}`
+
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestHandlerAcceptsValidSignature(t *testing.T) {
+	os.Setenv("GITHUB_WEBHOOK_SECRET", "topsecret")
+	defer os.Unsetenv("GITHUB_WEBHOOK_SECRET")
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader(testPushPayload))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-GitHub-Event", "push")
+	request.Header.Set("X-Hub-Signature-256", signPayload("topsecret", []byte(testPushPayload)))
+
+	recorder := httptest.NewRecorder()
+	Handler(recorder, request)
+
+	if recorder.Code != 200 {
+		t.Fatalf("expected status 200 for a valid signature, got %d", recorder.Code)
+	}
+}
+
+func TestHandlerRejectsForgedSignature(t *testing.T) {
+	os.Setenv("GITHUB_WEBHOOK_SECRET", "topsecret")
+	defer os.Unsetenv("GITHUB_WEBHOOK_SECRET")
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader(testPushPayload))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-GitHub-Event", "push")
+	request.Header.Set("X-Hub-Signature-256", signPayload("not-the-right-secret", []byte(testPushPayload)))
+
+	recorder := httptest.NewRecorder()
+	Handler(recorder, request)
+
+	if recorder.Code != 401 {
+		t.Fatalf("expected status 401 for a forged signature, got %d", recorder.Code)
+	}
+}
+
+func TestHandlerRejectsMissingSignature(t *testing.T) {
+	os.Setenv("GITHUB_WEBHOOK_SECRET", "topsecret")
+	defer os.Unsetenv("GITHUB_WEBHOOK_SECRET")
+
+	request := httptest.NewRequest("POST", "/", strings.NewReader(testPushPayload))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("X-GitHub-Event", "push")
+
+	recorder := httptest.NewRecorder()
+	Handler(recorder, request)
+
+	if recorder.Code != 401 {
+		t.Fatalf("expected status 401 for a missing signature, got %d", recorder.Code)
+	}
+}
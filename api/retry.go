@@ -0,0 +1,59 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// retryOptions configures the backoff behavior of withRetry.
+type retryOptions struct {
+	MaxAttempts  int
+	InitialDelay time.Duration
+}
+
+// permanentError wraps an error returned by withRetry's fn to signal that
+// the failure is not transient and further attempts should not be made.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+// withRetry calls fn until it succeeds, fn returns a permanentError, the
+// context is cancelled, or options.MaxAttempts is reached, doubling the
+// delay between attempts (exponential backoff) each time.
+func withRetry(ctx context.Context, options retryOptions, fn func() error) error {
+	delay := options.InitialDelay
+
+	var err error
+	for attempt := 1; attempt <= options.MaxAttempts; attempt++ {
+		err = fn()
+		if err == nil {
+			return nil
+		}
+
+		if permanent, ok := err.(*permanentError); ok {
+			return permanent.err
+		}
+
+		if attempt == options.MaxAttempts {
+			break
+		}
+
+		log.WithError(err).Warnf("Attempt %d/%d failed, retrying in %s", attempt, options.MaxAttempts, delay)
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+
+		delay *= 2
+	}
+
+	return err
+}
@@ -0,0 +1,130 @@
+package gitsource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	gitea "code.gitea.io/sdk/gitea"
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	log "github.com/sirupsen/logrus"
+)
+
+// Gitea is a Provider backed by a self-hosted Gitea instance.
+type Gitea struct {
+	config Config
+}
+
+// NewGitea builds a Gitea Provider from config.
+func NewGitea(config Config) *Gitea {
+	return &Gitea{config: config}
+}
+
+// Clone clones the configured repository into a temporary folder.
+func (g *Gitea) Clone() (string, *git.Repository, error) {
+	directory, err := ioutil.TempDir("", fmt.Sprintf("%s-%s", g.config.Owner, g.config.Repo))
+	if err != nil {
+		return directory, nil, err
+	}
+
+	url := cloneURL(g.config.APIURL, "https://gitea.com", g.config.Owner, g.config.Repo)
+
+	log.Infof("Cloning %s/%s to %s", g.config.Owner, g.config.Repo, directory)
+
+	repository, err := git.PlainClone(directory, false, &git.CloneOptions{
+		URL:      url,
+		Progress: os.Stdout,
+	})
+	if err != nil {
+		return directory, nil, err
+	}
+
+	log.Infof("Cloned %s/%s into %s", g.config.Owner, g.config.Repo, directory)
+
+	return directory, repository, nil
+}
+
+// Push pushes the named local branch to the remote origin.
+func (g *Gitea) Push(repository *git.Repository, branch string) error {
+	remote, err := repository.Remote("origin")
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Pushing to remote origin %s", remote.Config().URLs[0])
+
+	refSpec := fmt.Sprintf("refs/heads/%s:refs/heads/%s", branch, branch)
+	err = remote.Push(&git.PushOptions{
+		RefSpecs: []gitconfig.RefSpec{gitconfig.RefSpec(refSpec)},
+		Auth: &githttp.BasicAuth{
+			Username: g.config.Owner,
+			Password: g.config.Token,
+		},
+		Progress: os.Stdout,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Pushed to %s successfully", branch)
+
+	return nil
+}
+
+// Exists reports whether branch already exists on the remote repository,
+// or an open pull request from it.
+func (g *Gitea) Exists(branch string) (bool, error) {
+	client, err := gitea.NewClient(g.config.APIURL, gitea.SetToken(g.config.Token))
+	if err != nil {
+		return false, err
+	}
+
+	_, response, err := client.GetRepoBranch(g.config.Owner, g.config.Repo, branch)
+	if err == nil {
+		return true, nil
+	}
+
+	if response == nil || response.StatusCode != http.StatusNotFound {
+		return false, err
+	}
+
+	pulls, _, err := client.ListRepoPullRequests(g.config.Owner, g.config.Repo, gitea.ListPullRequestsOptions{
+		State: gitea.StateOpen,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	for _, pull := range pulls {
+		if pull.Head != nil && pull.Head.Ref == branch {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// OpenMergeRequest opens a pull request from branch onto master.
+func (g *Gitea) OpenMergeRequest(branch string, title string, body string) (string, error) {
+	client, err := gitea.NewClient(g.config.APIURL, gitea.SetToken(g.config.Token))
+	if err != nil {
+		return "", err
+	}
+
+	pull, _, err := client.CreatePullRequest(g.config.Owner, g.config.Repo, gitea.CreatePullRequestOption{
+		Title: title,
+		Body:  body,
+		Head:  branch,
+		Base:  "master",
+	})
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("Pull request #%d opened (%s)", pull.Index, pull.HTMLURL)
+
+	return pull.HTMLURL, nil
+}
@@ -0,0 +1,205 @@
+package gitsource
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	git "github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	"github.com/google/go-github/v32/github"
+	log "github.com/sirupsen/logrus"
+	"golang.org/x/oauth2"
+)
+
+// checkRunName identifies the check run GitHub displays for each update.
+const checkRunName = "libphonenumber-hook"
+
+// GitHub is a Provider backed by github.com or a GitHub Enterprise instance.
+type GitHub struct {
+	config Config
+}
+
+// NewGitHub builds a GitHub Provider from config.
+func NewGitHub(config Config) *GitHub {
+	return &GitHub{config: config}
+}
+
+// client builds an authenticated go-github client, pointed at config.APIURL
+// when set (a GitHub Enterprise instance) or github.com otherwise.
+func (g *GitHub) client(ctx context.Context) (*github.Client, error) {
+	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: g.config.Token})
+	tc := oauth2.NewClient(ctx, ts)
+
+	if g.config.APIURL == "" {
+		return github.NewClient(tc), nil
+	}
+
+	return github.NewEnterpriseClient(g.config.APIURL, g.config.APIURL, tc)
+}
+
+// Clone clones the configured repository into a temporary folder.
+func (g *GitHub) Clone() (string, *git.Repository, error) {
+	directory, err := ioutil.TempDir("", fmt.Sprintf("%s-%s", g.config.Owner, g.config.Repo))
+	if err != nil {
+		return directory, nil, err
+	}
+
+	url := cloneURL(g.config.APIURL, "https://github.com", g.config.Owner, g.config.Repo)
+
+	log.Infof("Cloning %s/%s to %s", g.config.Owner, g.config.Repo, directory)
+
+	repository, err := git.PlainClone(directory, false, &git.CloneOptions{
+		URL:      url,
+		Progress: os.Stdout,
+	})
+	if err != nil {
+		return directory, nil, err
+	}
+
+	log.Infof("Cloned %s/%s into %s", g.config.Owner, g.config.Repo, directory)
+
+	return directory, repository, nil
+}
+
+// Push pushes the named local branch to the remote origin.
+func (g *GitHub) Push(repository *git.Repository, branch string) error {
+	remote, err := repository.Remote("origin")
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Pushing to remote origin %s", remote.Config().URLs[0])
+
+	refSpec := fmt.Sprintf("refs/heads/%s:refs/heads/%s", branch, branch)
+	err = remote.Push(&git.PushOptions{
+		RefSpecs: []config.RefSpec{config.RefSpec(refSpec)},
+		Auth: &githttp.BasicAuth{
+			Username: g.config.Owner,
+			Password: g.config.Token,
+		},
+		Progress: os.Stdout,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Pushed to %s successfully", branch)
+
+	return nil
+}
+
+// OpenMergeRequest opens a pull request from branch onto master.
+func (g *GitHub) OpenMergeRequest(branch string, title string, body string) (string, error) {
+	ctx := context.Background()
+
+	client, err := g.client(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	pull, _, err := client.PullRequests.Create(ctx, g.config.Owner, g.config.Repo, &github.NewPullRequest{
+		Title: github.String(title),
+		Head:  github.String(branch),
+		Base:  github.String("master"),
+		Body:  github.String(body),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("Pull request #%d opened (%s)", *pull.Number, *pull.HTMLURL)
+
+	return *pull.HTMLURL, nil
+}
+
+// Exists reports whether branch already exists on the remote repository,
+// or an open pull request from it.
+func (g *GitHub) Exists(branch string) (bool, error) {
+	ctx := context.Background()
+
+	client, err := g.client(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	_, response, err := client.Repositories.GetBranch(ctx, g.config.Owner, g.config.Repo, branch)
+	if err == nil {
+		return true, nil
+	}
+
+	if response == nil || response.StatusCode != http.StatusNotFound {
+		return false, err
+	}
+
+	pulls, _, err := client.PullRequests.List(ctx, g.config.Owner, g.config.Repo, &github.PullRequestListOptions{
+		Head:  fmt.Sprintf("%s:%s", g.config.Owner, branch),
+		State: "open",
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return len(pulls) > 0, nil
+}
+
+// CreateCheckRun creates a check run on sha, moving it from queued to
+// in_progress so users can see the update is underway in the GitHub UI.
+func (g *GitHub) CreateCheckRun(sha string) (CheckRun, error) {
+	ctx := context.Background()
+
+	client, err := g.client(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	checkRun, _, err := client.Checks.CreateCheckRun(ctx, g.config.Owner, g.config.Repo, github.CreateCheckRunOptions{
+		Name:    checkRunName,
+		HeadSHA: sha,
+		Status:  github.String("queued"),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	updated, _, err := client.Checks.UpdateCheckRun(ctx, g.config.Owner, g.config.Repo, checkRun.GetID(), github.UpdateCheckRunOptions{
+		Name:   checkRunName,
+		Status: github.String("in_progress"),
+	})
+	if err != nil {
+		return checkRun, err
+	}
+
+	return updated, nil
+}
+
+// CompleteCheckRun marks checkRun as completed with conclusion, attaching
+// summary as the extraction log.
+func (g *GitHub) CompleteCheckRun(checkRun CheckRun, conclusion string, summary string) error {
+	ctx := context.Background()
+
+	client, err := g.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	run, ok := checkRun.(*github.CheckRun)
+	if !ok {
+		return fmt.Errorf("gitsource: unexpected check run type %T", checkRun)
+	}
+
+	_, _, err = client.Checks.UpdateCheckRun(ctx, g.config.Owner, g.config.Repo, run.GetID(), github.UpdateCheckRunOptions{
+		Name:       checkRunName,
+		Status:     github.String("completed"),
+		Conclusion: github.String(conclusion),
+		Output: &github.CheckRunOutput{
+			Title:   github.String("libphonenumber-hook extraction log"),
+			Summary: github.String(summary),
+		},
+	})
+
+	return err
+}
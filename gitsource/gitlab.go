@@ -0,0 +1,140 @@
+package gitsource
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+
+	git "github.com/go-git/go-git/v5"
+	gitconfig "github.com/go-git/go-git/v5/config"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+	log "github.com/sirupsen/logrus"
+	gitlab "github.com/xanzy/go-gitlab"
+)
+
+// GitLab is a Provider backed by gitlab.com or a self-hosted GitLab instance.
+type GitLab struct {
+	config Config
+}
+
+// NewGitLab builds a GitLab Provider from config.
+func NewGitLab(config Config) *GitLab {
+	return &GitLab{config: config}
+}
+
+// client builds a go-gitlab client, pointed at config.APIURL when set (a
+// self-hosted instance) or gitlab.com otherwise. gitlab.WithBaseURL("")
+// would set the client's base URL to the host-less "/api/v4/", so it's
+// only passed when APIURL is actually configured.
+func (g *GitLab) client() (*gitlab.Client, error) {
+	if g.config.APIURL == "" {
+		return gitlab.NewClient(g.config.Token)
+	}
+
+	return gitlab.NewClient(g.config.Token, gitlab.WithBaseURL(g.config.APIURL))
+}
+
+// Clone clones the configured project into a temporary folder.
+func (g *GitLab) Clone() (string, *git.Repository, error) {
+	directory, err := ioutil.TempDir("", fmt.Sprintf("%s-%s", g.config.Owner, g.config.Repo))
+	if err != nil {
+		return directory, nil, err
+	}
+
+	url := cloneURL(g.config.APIURL, "https://gitlab.com", g.config.Owner, g.config.Repo)
+
+	log.Infof("Cloning %s/%s to %s", g.config.Owner, g.config.Repo, directory)
+
+	repository, err := git.PlainClone(directory, false, &git.CloneOptions{
+		URL:      url,
+		Progress: os.Stdout,
+	})
+	if err != nil {
+		return directory, nil, err
+	}
+
+	log.Infof("Cloned %s/%s into %s", g.config.Owner, g.config.Repo, directory)
+
+	return directory, repository, nil
+}
+
+// Push pushes the named local branch to the remote origin.
+func (g *GitLab) Push(repository *git.Repository, branch string) error {
+	remote, err := repository.Remote("origin")
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Pushing to remote origin %s", remote.Config().URLs[0])
+
+	refSpec := fmt.Sprintf("refs/heads/%s:refs/heads/%s", branch, branch)
+	err = remote.Push(&git.PushOptions{
+		RefSpecs: []gitconfig.RefSpec{gitconfig.RefSpec(refSpec)},
+		Auth: &githttp.BasicAuth{
+			Username: "oauth2",
+			Password: g.config.Token,
+		},
+		Progress: os.Stdout,
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Pushed to %s successfully", branch)
+
+	return nil
+}
+
+// Exists reports whether branch already exists on the remote project, or
+// an open merge request from it.
+func (g *GitLab) Exists(branch string) (bool, error) {
+	client, err := g.client()
+	if err != nil {
+		return false, err
+	}
+
+	project := fmt.Sprintf("%s/%s", g.config.Owner, g.config.Repo)
+
+	_, response, err := client.Branches.GetBranch(project, branch)
+	if err == nil {
+		return true, nil
+	}
+
+	if response == nil || response.StatusCode != http.StatusNotFound {
+		return false, err
+	}
+
+	mergeRequests, _, err := client.MergeRequests.ListProjectMergeRequests(project, &gitlab.ListProjectMergeRequestsOptions{
+		SourceBranch: gitlab.String(branch),
+		State:        gitlab.String("opened"),
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return len(mergeRequests) > 0, nil
+}
+
+// OpenMergeRequest opens a merge request from branch onto master.
+func (g *GitLab) OpenMergeRequest(branch string, title string, body string) (string, error) {
+	client, err := g.client()
+	if err != nil {
+		return "", err
+	}
+
+	project := fmt.Sprintf("%s/%s", g.config.Owner, g.config.Repo)
+	mergeRequest, _, err := client.MergeRequests.CreateMergeRequest(project, &gitlab.CreateMergeRequestOptions{
+		Title:        gitlab.String(title),
+		Description:  gitlab.String(body),
+		SourceBranch: gitlab.String(branch),
+		TargetBranch: gitlab.String("master"),
+	})
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("Merge request !%d opened (%s)", mergeRequest.IID, mergeRequest.WebURL)
+
+	return mergeRequest.WebURL, nil
+}
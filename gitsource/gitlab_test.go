@@ -0,0 +1,29 @@
+package gitsource
+
+import "testing"
+
+func TestGitLabClientDefaultsToGitLabCom(t *testing.T) {
+	g := NewGitLab(Config{Token: "token", Owner: "owner", Repo: "repo"})
+
+	client, err := g.client()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if host := client.BaseURL().Host; host != "gitlab.com" {
+		t.Fatalf("expected base URL host to default to gitlab.com, got %q", host)
+	}
+}
+
+func TestGitLabClientHonorsAPIURL(t *testing.T) {
+	g := NewGitLab(Config{Token: "token", Owner: "owner", Repo: "repo", APIURL: "https://gitlab.example.com/api/v4"})
+
+	client, err := g.client()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if host := client.BaseURL().Host; host != "gitlab.example.com" {
+		t.Fatalf("expected base URL host to honor APIURL, got %q", host)
+	}
+}
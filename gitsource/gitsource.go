@@ -0,0 +1,119 @@
+// Package gitsource abstracts over the git hosting platform a downstream
+// libphonenumber port lives on, so the hook can keep a fork on GitHub,
+// GitLab or Gitea up to date without the rest of the codebase caring which.
+package gitsource
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+
+	git "github.com/go-git/go-git/v5"
+)
+
+// Provider is implemented by each supported git hosting platform.
+type Provider interface {
+	// Clone clones the downstream repository into a temporary directory
+	// and returns its path together with an opened go-git repository.
+	Clone() (string, *git.Repository, error)
+
+	// Push pushes the named local branch to the remote origin.
+	Push(repository *git.Repository, branch string) error
+
+	// OpenMergeRequest opens a merge (or pull) request from branch onto
+	// the repository's master branch and returns its HTML URL.
+	OpenMergeRequest(branch string, title string, body string) (string, error)
+
+	// Exists reports whether branch already exists on the remote
+	// repository, or an open merge/pull request from it, so a retried or
+	// re-pushed tag doesn't result in duplicate work.
+	Exists(branch string) (bool, error)
+}
+
+// CheckRun is an opaque handle to a check run created by a
+// ChecksReporter, passed back unchanged to CompleteCheckRun.
+type CheckRun interface{}
+
+// ChecksReporter is an optional capability implemented by Provider
+// backends that can report progress natively, currently only GitHub's
+// Checks API. Callers should type-assert a Provider against this
+// interface and treat its absence as "no native progress reporting".
+type ChecksReporter interface {
+	// CreateCheckRun creates a check run on sha, moving it to in_progress.
+	CreateCheckRun(sha string) (CheckRun, error)
+
+	// CompleteCheckRun marks checkRun as completed with conclusion,
+	// attaching summary as the extraction log.
+	CompleteCheckRun(checkRun CheckRun, conclusion string, summary string) error
+}
+
+// Config holds the connection details shared by every Provider
+// implementation, typically populated from environment variables.
+type Config struct {
+	APIURL string
+	Token  string
+	Owner  string
+	Repo   string
+}
+
+// NewFromEnv builds a Provider selected by the GITSOURCE_TYPE environment
+// variable ("github", "gitlab" or "gitea", defaulting to "github"),
+// configured from GITSOURCE_API_URL, GITSOURCE_TOKEN, GITSOURCE_OWNER and
+// GITSOURCE_REPO. GITSOURCE_OWNER, GITSOURCE_REPO and GITSOURCE_TOKEN fall
+// back to the original hardcoded GitHub-only values (and GITHUB_TOKEN)
+// when unset, so existing GitHub-only deployments keep working unchanged.
+func NewFromEnv() (Provider, error) {
+	config := Config{
+		APIURL: os.Getenv("GITSOURCE_API_URL"),
+		Token:  firstNonEmpty(os.Getenv("GITSOURCE_TOKEN"), os.Getenv("GITHUB_TOKEN")),
+		Owner:  envOrDefault("GITSOURCE_OWNER", "ruimarinho"),
+		Repo:   envOrDefault("GITSOURCE_REPO", "google-libphonenumber"),
+	}
+
+	switch sourceType := os.Getenv("GITSOURCE_TYPE"); sourceType {
+	case "", "github":
+		return NewGitHub(config), nil
+	case "gitlab":
+		return NewGitLab(config), nil
+	case "gitea":
+		return NewGitea(config), nil
+	default:
+		return nil, fmt.Errorf("unsupported GITSOURCE_TYPE %q", sourceType)
+	}
+}
+
+// envOrDefault returns the value of the named environment variable, or
+// fallback when it is unset or empty.
+func envOrDefault(key string, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+
+	return fallback
+}
+
+// firstNonEmpty returns the first non-empty value, or "" if all are empty.
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+
+	return ""
+}
+
+// cloneURL builds the HTTPS clone URL for owner/repo, using the host of
+// apiURL when set or falling back to fallbackHost otherwise (e.g. an
+// unconfigured GITSOURCE_API_URL defaults to the public github.com host).
+func cloneURL(apiURL string, fallbackHost string, owner string, repo string) string {
+	host := fallbackHost
+
+	if apiURL != "" {
+		if parsed, err := url.Parse(apiURL); err == nil && parsed.Host != "" {
+			host = fmt.Sprintf("%s://%s", parsed.Scheme, parsed.Host)
+		}
+	}
+
+	return fmt.Sprintf("%s/%s/%s.git", host, owner, repo)
+}
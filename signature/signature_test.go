@@ -0,0 +1,54 @@
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testPayload = `{"ref":"refs/heads/master"}`
+
+func sign(secret string, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(payload))
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestVerifyAcceptsValidSignature(t *testing.T) {
+	request := httptest.NewRequest("POST", "/", strings.NewReader(testPayload))
+	request.Header.Set("X-Hub-Signature-256", sign("topsecret", testPayload))
+
+	if err := Verify(request, "topsecret"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
+
+func TestVerifyRejectsForgedSignature(t *testing.T) {
+	request := httptest.NewRequest("POST", "/", strings.NewReader(testPayload))
+	request.Header.Set("X-Hub-Signature-256", sign("not-the-right-secret", testPayload))
+
+	if err := Verify(request, "topsecret"); err != ErrInvalid {
+		t.Fatalf("expected ErrInvalid, got %v", err)
+	}
+}
+
+func TestVerifyRejectsMissingSignature(t *testing.T) {
+	request := httptest.NewRequest("POST", "/", strings.NewReader(testPayload))
+
+	if err := Verify(request, "topsecret"); err != ErrMissing {
+		t.Fatalf("expected ErrMissing, got %v", err)
+	}
+}
+
+func TestVerifyRejectsEmptySecret(t *testing.T) {
+	request := httptest.NewRequest("POST", "/", strings.NewReader(testPayload))
+	request.Header.Set("X-Hub-Signature-256", sign("", testPayload))
+
+	if err := Verify(request, ""); err != ErrEmptySecret {
+		t.Fatalf("expected ErrEmptySecret, got %v", err)
+	}
+}
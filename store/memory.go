@@ -0,0 +1,34 @@
+package store
+
+import "sync"
+
+// Memory is an in-memory Store. It does not survive a process restart,
+// which is fine for a single long-lived instance but not across the cold
+// starts of a serverless deployment — use Redis or S3 there instead.
+type Memory struct {
+	mutex sync.Mutex
+	seen  map[string]bool
+}
+
+// NewMemory builds an empty Memory store.
+func NewMemory() *Memory {
+	return &Memory{seen: make(map[string]bool)}
+}
+
+// Seen reports whether key has been recorded before.
+func (m *Memory) Seen(key string) (bool, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	return m.seen[key], nil
+}
+
+// Mark records key as seen.
+func (m *Memory) Mark(key string) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	m.seen[key] = true
+
+	return nil
+}
@@ -0,0 +1,29 @@
+package store
+
+import "testing"
+
+func TestMemorySeenAndMark(t *testing.T) {
+	memory := NewMemory()
+
+	seen, err := memory.Seen("delivery:1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if seen {
+		t.Fatal("expected key to be unseen before it was marked")
+	}
+
+	if err := memory.Mark("delivery:1"); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	seen, err = memory.Seen("delivery:1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !seen {
+		t.Fatal("expected key to be seen after it was marked")
+	}
+}
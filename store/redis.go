@@ -0,0 +1,33 @@
+package store
+
+import (
+	"context"
+
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis is a Store backed by a Redis instance, used to share dedup state
+// across the cold starts of a serverless deployment.
+type Redis struct {
+	client *redis.Client
+}
+
+// NewRedis builds a Redis store connecting to addr.
+func NewRedis(addr string) (*Redis, error) {
+	return &Redis{client: redis.NewClient(&redis.Options{Addr: addr})}, nil
+}
+
+// Seen reports whether key has been recorded before.
+func (r *Redis) Seen(key string) (bool, error) {
+	count, err := r.client.Exists(context.Background(), key).Result()
+	if err != nil {
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// Mark records key as seen.
+func (r *Redis) Mark(key string) error {
+	return r.client.Set(context.Background(), key, true, 0).Err()
+}
@@ -0,0 +1,64 @@
+package store
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// S3 is a Store backed by an S3 bucket, recording each key as one empty
+// object. Useful when a Redis instance isn't otherwise part of the stack.
+type S3 struct {
+	client *s3.S3
+	bucket string
+}
+
+// NewS3 builds an S3 store writing objects into bucket.
+func NewS3(bucket string) (*S3, error) {
+	if bucket == "" {
+		return nil, errors.New("STORE_S3_BUCKET must be set to use the s3 store")
+	}
+
+	session, err := session.NewSession()
+	if err != nil {
+		return nil, err
+	}
+
+	return &S3{client: s3.New(session), bucket: bucket}, nil
+}
+
+// Seen reports whether key has been recorded before.
+func (store *S3) Seen(key string) (bool, error) {
+	_, err := store.client.HeadObject(&s3.HeadObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(objectKey(key)),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+// Mark records key as seen.
+func (store *S3) Mark(key string) error {
+	_, err := store.client.PutObject(&s3.PutObjectInput{
+		Bucket: aws.String(store.bucket),
+		Key:    aws.String(objectKey(key)),
+		Body:   strings.NewReader(""),
+	})
+
+	return err
+}
+
+func objectKey(key string) string {
+	return strings.ReplaceAll(key, ":", "/")
+}
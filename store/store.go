@@ -0,0 +1,34 @@
+// Package store persists small pieces of state the handler uses to
+// recognize repeated webhook deliveries and already-handled library
+// versions, so a retried delivery or a re-pushed tag doesn't result in
+// duplicate work.
+package store
+
+import (
+	"fmt"
+	"os"
+)
+
+// Store records which keys have already been processed.
+type Store interface {
+	// Seen reports whether key has been recorded before.
+	Seen(key string) (bool, error)
+
+	// Mark records key as seen.
+	Mark(key string) error
+}
+
+// NewFromEnv builds a Store selected by the STORE_TYPE environment
+// variable ("memory", "redis" or "s3", defaulting to "memory").
+func NewFromEnv() (Store, error) {
+	switch storeType := os.Getenv("STORE_TYPE"); storeType {
+	case "", "memory":
+		return NewMemory(), nil
+	case "redis":
+		return NewRedis(os.Getenv("REDIS_ADDR"))
+	case "s3":
+		return NewS3(os.Getenv("STORE_S3_BUCKET"))
+	default:
+		return nil, fmt.Errorf("unsupported STORE_TYPE %q", storeType)
+	}
+}
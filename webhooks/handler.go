@@ -3,48 +3,96 @@ package function
 import (
 	"archive/tar"
 	"compress/gzip"
-	"context"
 	"fmt"
 	"io"
-	"io/ioutil"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	git "github.com/go-git/go-git/v5"
-	"github.com/go-git/go-git/v5/config"
 	"github.com/go-git/go-git/v5/plumbing"
 	"github.com/go-git/go-git/v5/plumbing/object"
-	"github.com/go-git/go-git/v5/plumbing/transport/client"
-	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
-	"github.com/google/go-github/v32/github"
 	log "github.com/sirupsen/logrus"
-	"golang.org/x/oauth2"
 	ghooks "gopkg.in/go-playground/webhooks.v5/github"
+
+	"github.com/ruimarinho/libphonenumber-hook/gitsource"
+	"github.com/ruimarinho/libphonenumber-hook/signature"
+	"github.com/ruimarinho/libphonenumber-hook/store"
+)
+
+var (
+	dataStore     store.Store
+	dataStoreErr  error
+	dataStoreOnce sync.Once
 )
 
+// getStore returns the process-wide Store, constructing it from the
+// environment on first use so delivery/version dedup is shared across
+// invocations of the same warm instance instead of starting from an
+// empty map every time.
+func getStore() (store.Store, error) {
+	dataStoreOnce.Do(func() {
+		dataStore, dataStoreErr = store.NewFromEnv()
+	})
+
+	return dataStore, dataStoreErr
+}
+
 // Handle a function invocation
 func Handle(w http.ResponseWriter, r *http.Request) {
-	hook, _ := ghooks.New()
+	if err := signature.Verify(r, os.Getenv("GITHUB_WEBHOOK_SECRET")); err != nil {
+		log.WithError(err).Warn("Rejecting webhook with invalid signature")
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte("Invalid signature"))
+		return
+	}
+
+	hook, err := ghooks.New()
+	if err != nil {
+		log.Panic(err)
+	}
+
 	payload, err := hook.Parse(r, ghooks.PushEvent)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	HandleEvent(payload)
+	HandleEvent(payload, r.Header.Get("X-GitHub-Delivery"))
 
 	w.Write([]byte("OK"))
 	w.WriteHeader(http.StatusOK)
 }
 
-// HandleEvent handles multiple GitHub events.
-func HandleEvent(payload interface{}) {
+// HandleEvent handles multiple GitHub events. deliveryID is the value of
+// the X-GitHub-Delivery header, if any, and is used to dedupe retried
+// webhook deliveries.
+func HandleEvent(payload interface{}, deliveryID string) {
 	log.WithField("payload", payload).Info("Handling incoming libphonenumber-webhook")
 
-	push := payload.(ghooks.PushPayload)
+	dataStore, err := getStore()
+	if err != nil {
+		log.Panic(err)
+	}
+
+	deliveryKey := ""
+	if deliveryID != "" {
+		deliveryKey = fmt.Sprintf("delivery:%s", deliveryID)
+
+		seen, err := dataStore.Seen(deliveryKey)
+		if err != nil {
+			log.Panic(err)
+		}
+
+		if seen {
+			log.Infof("Delivery %s already processed, skipping", deliveryID)
+			return
+		}
+	}
 
+	push := payload.(ghooks.PushPayload)
 	if !strings.Contains(push.Ref, "refs/tags/") {
 		log.Warn("Push reference is not a tag, skipping")
 		return
@@ -54,80 +102,136 @@ func HandleEvent(payload interface{}) {
 
 	log.Info("Received push payload for version v", version)
 
-	directory, repo, err := Clone()
+	source, err := gitsource.NewFromEnv()
 	if err != nil {
 		log.Panic(err)
 	}
 
-	file, err := Download(version)
+	versionKey := fmt.Sprintf("version:%s", version)
+
+	seen, err := dataStore.Seen(versionKey)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	err = Extract(file, directory)
-	if err != nil {
-		log.Panic(err)
+	if seen {
+		log.Infof("Version %s already processed, skipping", version)
+		return
 	}
 
-	err = Commit(version, repo, &CommitOptions{Push: true})
+	branch := fmt.Sprintf("support/update-libphonenumber-%s", strings.Replace(version, ".", "-", -1))
+
+	exists, err := source.Exists(branch)
 	if err != nil {
 		log.Panic(err)
 	}
 
-	OpenPullRequest(version)
-}
+	if exists {
+		log.Infof("Branch or merge request for %s already exists, skipping", branch)
+		return
+	}
 
-// CommitOptions holds information about commit options.
-type CommitOptions struct {
-	Push bool
-}
+	checks, _ := source.(gitsource.ChecksReporter)
 
-func Clone() (string, *git.Repository, error) {
-	customClient := &http.Client{
-		// 15 second timeout
-		Timeout: 15 * time.Second,
+	var checkRun gitsource.CheckRun
+	if checks != nil {
+		checkRun, err = checks.CreateCheckRun(push.After)
+		if err != nil {
+			log.Panic(err)
+		}
 	}
 
-	// Override http(s) default protocol to use our custom client
-	client.InstallProtocol("https", githttp.NewClient(customClient))
+	fail := func(err error) {
+		if checks != nil {
+			checks.CompleteCheckRun(checkRun, "failure", err.Error())
+		}
 
-	directory, err := ioutil.TempDir("", "libphonenumber")
-	if err != nil {
-		return directory, nil, err
+		log.Panic(err)
 	}
 
-	log.Infof("Cloning ruimarinho/google-libphonenumber to %s", directory)
+	directory, repo, err := source.Clone()
+	if err != nil {
+		fail(err)
+	}
 
-	repo, err := git.PlainClone(directory, false, &git.CloneOptions{
-		URL:      "https://github.com/ruimarinho/google-libphonenumber.git",
-		Progress: os.Stdout,
-	})
+	stats, err := Commit(source, version, directory, repo, &CommitOptions{Push: true})
+	if err != nil {
+		fail(err)
+	}
 
+	url, err := source.OpenMergeRequest(branch, fmt.Sprintf("Update libphonenumber@%s", version), renderMergeRequestBody(version, stats))
 	if err != nil {
-		return directory, nil, err
+		fail(err)
+	}
+
+	log.Infof("Merge request opened (%s)", url)
+
+	// Only mark the version (and the delivery that triggered it) as seen
+	// once the merge request actually exists; none of the stores expire
+	// entries, so marking any earlier would permanently skip a legitimate
+	// retry after a transient Clone/Commit/OpenMergeRequest failure.
+	if err := dataStore.Mark(versionKey); err != nil {
+		log.Panic(err)
 	}
 
-	log.Infof("Cloned ruimarinho/google-libphonenumber to %s", directory)
+	if deliveryKey != "" {
+		if err := dataStore.Mark(deliveryKey); err != nil {
+			log.Panic(err)
+		}
+	}
 
-	return directory, repo, nil
+	if checks != nil {
+		checks.CompleteCheckRun(checkRun, "success", fmt.Sprintf("Updated libphonenumber to v%s.", version))
+	}
+}
+
+// CommitOptions holds information about commit options.
+type CommitOptions struct {
+	Push bool
 }
 
-// Commit creates a branch and commits on that branch the modified index tree.
-func Commit(version string, repo *git.Repository, options *CommitOptions) error {
+// Commit creates a branch and commits the modified index tree on that
+// branch, after validating the extracted files, returning the per-file
+// line stats between the branch's base commit and the new commit.
+func Commit(source gitsource.Provider, version string, directory string, repo *git.Repository, options *CommitOptions) (object.FileStats, error) {
 	worktree, err := repo.Worktree()
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	head, err := repo.Head()
+	if err != nil {
+		return nil, err
+	}
+
+	baseCommit, err := repo.CommitObject(head.Hash())
+	if err != nil {
+		return nil, err
 	}
 
 	tag := strings.Replace(version, ".", "-", -1)
+	branch := fmt.Sprintf("support/update-libphonenumber-%s", tag)
+
 	err = worktree.Checkout(&git.CheckoutOptions{
 		Create: true,
-		Branch: plumbing.ReferenceName(fmt.Sprintf("refs/heads/support/update-libphonenumber-%s", tag)),
+		Branch: plumbing.ReferenceName(fmt.Sprintf("refs/heads/%s", branch)),
 		Force:  true,
 	})
+	if err != nil {
+		return nil, err
+	}
 
+	file, err := Download(version)
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	if err := Extract(file, directory); err != nil {
+		return nil, err
+	}
+
+	if err := Validate(version, directory); err != nil {
+		return nil, err
 	}
 
 	commit, err := worktree.Commit(fmt.Sprintf("Update libphonenumber@%s", version), &git.CommitOptions{
@@ -138,74 +242,34 @@ func Commit(version string, repo *git.Repository, options *CommitOptions) error
 			When:  time.Now(),
 		},
 	})
-
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	log.Infof("Committed %s", commit.String())
 
-	if !options.Push {
-		log.Warn("Skipping commit push")
-		return nil
-	}
-
-	err = push(version, repo)
+	currentCommit, err := repo.CommitObject(commit)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
-}
-
-// Push commit to remote origin.
-func push(version string, repo *git.Repository) error {
-	remote, err := repo.Remote("origin")
+	patch, err := baseCommit.Patch(currentCommit)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	log.Infof("Pushing to remote origin %s", remote.Config().URLs[0])
+	stats := patch.Stats()
 
-	tag := strings.Replace(version, ".", "-", -1)
-	pushOptions := git.PushOptions{
-		RefSpecs: []config.RefSpec{config.RefSpec(fmt.Sprintf("refs/heads/support/update-libphonenumber-%s:refs/heads/support/update-libphonenumber-%s", tag, tag))},
-		Auth: &githttp.BasicAuth{
-			Username: "ruimarinho",
-			Password: os.Getenv("GITHUB_TOKEN"),
-		},
-		Progress: os.Stdout,
+	if !options.Push {
+		log.Warn("Skipping commit push")
+		return stats, nil
 	}
 
-	err = remote.Push(&pushOptions)
-	if err != nil {
-		return err
+	if err := source.Push(repo, branch); err != nil {
+		return stats, err
 	}
 
-	log.Infof("Pushed to %s successfully", fmt.Sprintf("support/update-libphonenumber-%s", tag))
-
-	return nil
-}
-
-func OpenPullRequest(version string) error {
-	ctx := context.Background()
-	ts := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: os.Getenv("GITHUB_TOKEN")})
-	tc := oauth2.NewClient(ctx, ts)
-	client := github.NewClient(tc)
-	pull, _, err := client.PullRequests.Create(ctx, "ruimarinho", "google-libphonenumber", &github.NewPullRequest{
-		Title: github.String(fmt.Sprintf("Update libphonenumber@%s", version)),
-		Head:  github.String(fmt.Sprintf("support/update-libphonenumber-%s", strings.Replace(version, ".", "-", -1))),
-		Base:  github.String("master"),
-		Body:  github.String(fmt.Sprintf("Update libphonenumber@%s.", version)),
-	})
-
-	if err != nil {
-		return err
-	}
-
-	log.Info(fmt.Sprintf("Pull request #%d opened (%v)", *pull.Number, *pull.HTMLURL))
-
-	return nil
+	return stats, nil
 }
 
 func Extract(file io.ReadCloser, directory string) error {
@@ -254,7 +318,7 @@ func Extract(file io.ReadCloser, directory string) error {
 }
 
 func Download(version string) (io.ReadCloser, error) {
-	resp, err := http.Get(fmt.Sprintf("https://github.com/googlei18n/libphonenumber/archive/v%s.tar.gz", version))
+	resp, err := http.Get(fmt.Sprintf("https://github.com/google/libphonenumber/archive/v%s.tar.gz", version))
 
 	if err != nil {
 		return nil, err
@@ -262,3 +326,26 @@ func Download(version string) (io.ReadCloser, error) {
 
 	return resp.Body, nil
 }
+
+// renderMergeRequestBody builds a Markdown merge/pull request body
+// summarizing the update, linking to the upstream release notes and
+// listing the added/removed line counts of each changed file.
+func renderMergeRequestBody(version string, stats object.FileStats) string {
+	var body strings.Builder
+
+	fmt.Fprintf(&body, "Update libphonenumber@%s.\n\n", version)
+	fmt.Fprintf(&body, "See the [upstream release notes](https://github.com/google/libphonenumber/releases/tag/v%s) for details.\n\n", version)
+
+	if len(stats) == 0 {
+		return body.String()
+	}
+
+	body.WriteString("| File | Added | Removed |\n")
+	body.WriteString("| --- | ---: | ---: |\n")
+
+	for _, stat := range stats {
+		fmt.Fprintf(&body, "| %s | +%d | -%d |\n", filepath.Base(stat.Name), stat.Addition, stat.Deletion)
+	}
+
+	return body.String()
+}
@@ -0,0 +1,125 @@
+package function
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/go-github/v32/github"
+	log "github.com/sirupsen/logrus"
+)
+
+// Validate checks the javascript files extracted into directory/src
+// against the checksums published alongside the upstream release (when
+// available) and a lightweight syntax check, returning an error
+// describing the first problem found.
+func Validate(version string, directory string) error {
+	manifest, err := fetchChecksumManifest(github.NewClient(nil), version)
+	if err != nil {
+		log.WithError(err).Warn("Could not fetch upstream checksums, skipping hash verification")
+	}
+
+	sourceDirectory := filepath.Join(directory, "src")
+
+	files, err := ioutil.ReadDir(sourceDirectory)
+	if err != nil {
+		return err
+	}
+
+	for _, file := range files {
+		if file.IsDir() {
+			continue
+		}
+
+		path := filepath.Join(sourceDirectory, file.Name())
+
+		contents, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		if expected, ok := manifest[file.Name()]; ok {
+			actual := fmt.Sprintf("%x", sha256.Sum256(contents))
+			if actual != expected {
+				return fmt.Errorf("checksum mismatch for %s: expected %s, got %s", file.Name(), expected, actual)
+			}
+		}
+
+		if err := validateSyntax(path, contents); err != nil {
+			return fmt.Errorf("invalid javascript in %s: %w", file.Name(), err)
+		}
+	}
+
+	return nil
+}
+
+// validateSyntax rejects empty or non-UTF-8 contents and then, when node
+// is available on PATH, also runs `node --check` against path.
+func validateSyntax(path string, contents []byte) error {
+	if len(contents) == 0 {
+		return fmt.Errorf("file is empty")
+	}
+
+	if !utf8.Valid(contents) {
+		return fmt.Errorf("file is not valid UTF-8")
+	}
+
+	node, err := exec.LookPath("node")
+	if err != nil {
+		return nil
+	}
+
+	output, err := exec.Command(node, "--check", path).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s", strings.TrimSpace(string(output)))
+	}
+
+	return nil
+}
+
+// fetchChecksumManifest downloads and parses the SHA256SUMS asset
+// published alongside the upstream release, if any, as a map of
+// filename to lowercase hex-encoded SHA-256 digest.
+func fetchChecksumManifest(client *github.Client, version string) (map[string]string, error) {
+	ctx := context.Background()
+
+	release, _, err := client.Repositories.GetReleaseByTag(ctx, "google", "libphonenumber", fmt.Sprintf("v%s", version))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, asset := range release.Assets {
+		if asset.GetName() != "SHA256SUMS" {
+			continue
+		}
+
+		response, err := http.Get(asset.GetBrowserDownloadURL())
+		if err != nil {
+			return nil, err
+		}
+
+		defer response.Body.Close()
+
+		manifest := make(map[string]string)
+		scanner := bufio.NewScanner(response.Body)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) != 2 {
+				continue
+			}
+
+			manifest[filepath.Base(fields[1])] = fields[0]
+		}
+
+		return manifest, scanner.Err()
+	}
+
+	return nil, fmt.Errorf("release v%s has no SHA256SUMS asset", version)
+}
@@ -0,0 +1,38 @@
+package function
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateSyntaxRejectsEmptyFile(t *testing.T) {
+	if err := validateSyntax("empty.js", []byte{}); err == nil {
+		t.Fatal("expected an error for an empty file")
+	}
+}
+
+func TestValidateSyntaxRejectsNonUTF8(t *testing.T) {
+	if err := validateSyntax("invalid.js", []byte{0xff, 0xfe, 0xfd}); err == nil {
+		t.Fatal("expected an error for non-UTF-8 content")
+	}
+}
+
+func TestValidateSyntaxAcceptsPlainText(t *testing.T) {
+	directory, err := ioutil.TempDir("", "validate-syntax")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer os.RemoveAll(directory)
+
+	path := filepath.Join(directory, "metadata.js")
+	contents := []byte("var x = 1;\n")
+	if err := ioutil.WriteFile(path, contents, 0644); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := validateSyntax(path, contents); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}